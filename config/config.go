@@ -17,7 +17,11 @@ package config // import "go.opentelemetry.io/collector/config"
 import (
 	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -34,6 +38,12 @@ type Config struct {
 	Processors
 	Extensions
 	Service
+
+	// StrictUnused causes Validate to fail when a configured receiver, processor,
+	// exporter, or extension is not referenced by the service. When false (the
+	// default), the same condition is only logged as a warning, to ease migration
+	// of existing configs onto this check.
+	StrictUnused bool `mapstructure:"strict_unused"`
 }
 
 var _ validatable = (*Config)(nil)
@@ -42,7 +52,7 @@ var _ validatable = (*Config)(nil)
 //
 // This function performs basic validation of configuration. There may be more subtle
 // invalid cases that we currently don't check for but which we may want to add in
-// the future (e.g. disallowing receiving and exporting on the same endpoint).
+// the future.
 func (cfg *Config) Validate() error {
 	// Currently there is no default receiver enabled.
 	// The configuration must specify at least one receiver to be valid.
@@ -108,7 +118,12 @@ func (cfg *Config) validateService() error {
 
 	// Check that all pipelines have at least one receiver and one exporter, and they reference
 	// only configured components.
-	for _, pipeline := range cfg.Service.Pipelines {
+	for id, pipeline := range cfg.Service.Pipelines {
+		inputType, err := pipelineInputType(id, pipeline)
+		if err != nil {
+			return err
+		}
+
 		// Validate pipeline has at least one receiver.
 		if len(pipeline.Receivers) == 0 {
 			return fmt.Errorf("pipeline %q must have at least one receiver", pipeline.Name)
@@ -117,17 +132,25 @@ func (cfg *Config) validateService() error {
 		// Validate pipeline receiver name references.
 		for _, ref := range pipeline.Receivers {
 			// Check that the name referenced in the pipeline's receivers exists in the top-level receivers.
-			if cfg.Receivers[ref] == nil {
+			recvCfg := cfg.Receivers[ref]
+			if recvCfg == nil {
 				return fmt.Errorf("pipeline %q references receiver %q which does not exist", pipeline.Name, ref)
 			}
+			if err := validateDataTypeSupport(recvCfg, inputType); err != nil {
+				return fmt.Errorf("pipeline %q receiver %q %w", pipeline.Name, ref, err)
+			}
 		}
 
 		// Validate pipeline processor name references.
 		for _, ref := range pipeline.Processors {
 			// Check that the name referenced in the pipeline's processors exists in the top-level processors.
-			if cfg.Processors[ref] == nil {
+			procCfg := cfg.Processors[ref]
+			if procCfg == nil {
 				return fmt.Errorf("pipeline %q references processor %q which does not exist", pipeline.Name, ref)
 			}
+			if err := validateDataTypeSupport(procCfg, inputType); err != nil {
+				return fmt.Errorf("pipeline %q processor %q %w", pipeline.Name, ref, err)
+			}
 		}
 
 		// Validate pipeline has at least one exporter.
@@ -138,11 +161,136 @@ func (cfg *Config) validateService() error {
 		// Validate pipeline exporter name references.
 		for _, ref := range pipeline.Exporters {
 			// Check that the name referenced in the pipeline's Exporters exists in the top-level Exporters.
-			if cfg.Exporters[ref] == nil {
+			expCfg := cfg.Exporters[ref]
+			if expCfg == nil {
 				return fmt.Errorf("pipeline %q references exporter %q which does not exist", pipeline.Name, ref)
 			}
+			if err := validateDataTypeSupport(expCfg, inputType); err != nil {
+				return fmt.Errorf("pipeline %q exporter %q %w", pipeline.Name, ref, err)
+			}
+		}
+	}
+
+	if err := cfg.validateReferences(); err != nil {
+		return err
+	}
+
+	_, err := cfg.Graph()
+	return err
+}
+
+// pipelineDataTypes are the DataType values a pipeline's own ComponentID key
+// may declare, e.g. the "traces" in "traces/foo".
+var pipelineDataTypes = map[DataType]bool{
+	TracesDataType:  true,
+	MetricsDataType: true,
+	LogsDataType:    true,
+}
+
+// pipelineInputType returns the DataType that pipeline p effectively has: the
+// type implied by id's own Type() when p.InputType is unset, or p.InputType
+// itself once it has been checked to agree with id and to be one of the known
+// DataTypes. It does not mutate p, so Validate and Graph can both derive the
+// same answer from a Pipeline regardless of which of them runs first or how
+// many times either is called.
+func pipelineInputType(id ComponentID, p *Pipeline) (DataType, error) {
+	keyType := DataType(id.Type())
+	if !pipelineDataTypes[keyType] {
+		return "", fmt.Errorf("pipeline %q has unknown pipeline type %q", p.Name, keyType)
+	}
+	if p.InputType == "" {
+		return keyType, nil
+	}
+	if p.InputType != keyType {
+		return "", fmt.Errorf("pipeline %q has input type %q which does not match its pipeline type %q", p.Name, p.InputType, keyType)
+	}
+	return p.InputType, nil
+}
+
+// DataTypeSupporter is an optional interface implemented by a receiver,
+// processor, or exporter configuration that only supports a subset of the
+// DataTypes its component type can be configured for. Config.Validate uses it
+// to catch a pipeline wired to a component that cannot actually handle the
+// pipeline's data type, e.g. an otlp exporter instance configured to only
+// accept traces referenced from a metrics pipeline. A config that does not
+// implement this interface is assumed to support whatever data type it is
+// configured for.
+type DataTypeSupporter interface {
+	// SupportedDataTypes returns the DataTypes this component instance supports.
+	SupportedDataTypes() []DataType
+}
+
+// validateDataTypeSupport checks cfg against dt if cfg implements DataTypeSupporter.
+func validateDataTypeSupport(cfg validatable, dt DataType) error {
+	supporter, ok := cfg.(DataTypeSupporter)
+	if !ok {
+		return nil
+	}
+	for _, supported := range supporter.SupportedDataTypes() {
+		if supported == dt {
+			return nil
+		}
+	}
+	return fmt.Errorf("does not support data type %q", dt)
+}
+
+// validateReferences checks the reverse direction from validateService's pipeline
+// reference checks: that every receiver, processor, exporter, and extension
+// configured at the top level is actually referenced from the service. A
+// component that is configured but never wired in is almost always a mistake,
+// e.g. a typo that moved a receiver out of its pipeline's receivers list.
+func (cfg *Config) validateReferences() error {
+	usedReceivers := map[ComponentID]bool{}
+	usedProcessors := map[ComponentID]bool{}
+	usedExporters := map[ComponentID]bool{}
+	usedExtensions := map[ComponentID]bool{}
+
+	for _, ref := range cfg.Service.Extensions {
+		usedExtensions[ref] = true
+	}
+	for _, pipeline := range cfg.Service.Pipelines {
+		for _, ref := range pipeline.Receivers {
+			usedReceivers[ref] = true
+		}
+		for _, ref := range pipeline.Processors {
+			usedProcessors[ref] = true
+		}
+		for _, ref := range pipeline.Exporters {
+			usedExporters[ref] = true
+		}
+	}
+
+	var unused []string
+	for id := range cfg.Receivers {
+		if !usedReceivers[id] {
+			unused = append(unused, fmt.Sprintf("receiver %q", id))
+		}
+	}
+	for id := range cfg.Processors {
+		if !usedProcessors[id] {
+			unused = append(unused, fmt.Sprintf("processor %q", id))
+		}
+	}
+	for id := range cfg.Exporters {
+		if !usedExporters[id] {
+			unused = append(unused, fmt.Sprintf("exporter %q", id))
+		}
+	}
+	for id := range cfg.Extensions {
+		if !usedExtensions[id] {
+			unused = append(unused, fmt.Sprintf("extension %q", id))
 		}
 	}
+	if len(unused) == 0 {
+		return nil
+	}
+	sort.Strings(unused)
+
+	msg := fmt.Sprintf("configured but not used by any pipeline or the service: %s", strings.Join(unused, ", "))
+	if cfg.StrictUnused {
+		return errors.New(msg)
+	}
+	zap.L().Warn(msg)
 	return nil
 }
 
@@ -159,11 +307,19 @@ type Service struct {
 
 // ServiceTelemetry defines the configurable settings for service telemetry.
 type ServiceTelemetry struct {
-	Logs ServiceTelemetryLogs `mapstructure:"logs"`
+	Logs    ServiceTelemetryLogs    `mapstructure:"logs"`
+	Metrics ServiceTelemetryMetrics `mapstructure:"metrics"`
+	Traces  ServiceTelemetryTraces  `mapstructure:"traces"`
 }
 
 func (srvT *ServiceTelemetry) validate() error {
-	return srvT.Logs.validate()
+	if err := srvT.Logs.validate(); err != nil {
+		return err
+	}
+	if err := srvT.Metrics.validate(); err != nil {
+		return err
+	}
+	return srvT.Traces.validate()
 }
 
 // ServiceTelemetryLogs defines the configurable settings for service telemetry logs.
@@ -189,6 +345,61 @@ func (srvTL *ServiceTelemetryLogs) validate() error {
 	return nil
 }
 
+// ServiceTelemetryMetrics defines the configurable settings for service telemetry metrics.
+type ServiceTelemetryMetrics struct {
+	// Level is the level of the metrics to be generated.
+	Level string `mapstructure:"level"`
+
+	// Address is the [address]:port that serves the Prometheus metrics for scraping.
+	Address string `mapstructure:"address"`
+
+	// Endpoint, if set, is the OTLP endpoint the collector pushes its own metrics
+	// to out-of-process, instead of (or in addition to) serving Address for
+	// scraping. This is useful for sidecar/daemonset deployments where nothing is
+	// left behind to scrape the collector once it is torn down.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Headers are additional headers sent with every request to Endpoint.
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// validMetricsTelemetryLevels are the valid values for ServiceTelemetryMetrics.Level.
+var validMetricsTelemetryLevels = map[string]bool{
+	"none":     true,
+	"basic":    true,
+	"normal":   true,
+	"detailed": true,
+}
+
+func (srvTM *ServiceTelemetryMetrics) validate() error {
+	if srvTM.Level != "" && !validMetricsTelemetryLevels[srvTM.Level] {
+		return fmt.Errorf(`service telemetry metrics invalid level: %q, valid values are "none", "basic", "normal" and "detailed"`, srvTM.Level)
+	}
+	if srvTM.Address != "" {
+		if _, _, err := net.SplitHostPort(srvTM.Address); err != nil {
+			return fmt.Errorf("service telemetry metrics invalid address: %w", err)
+		}
+	}
+	return nil
+}
+
+// ServiceTelemetryTraces defines the configurable settings for service telemetry traces.
+type ServiceTelemetryTraces struct {
+	// Propagators is the list of propagators to use for the global trace propagator.
+	Propagators []string `mapstructure:"propagators"`
+
+	// Endpoint, if set, is the OTLP endpoint the collector pushes its own traces
+	// to out-of-process.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Headers are additional headers sent with every request to Endpoint.
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+func (srvTT *ServiceTelemetryTraces) validate() error {
+	return nil
+}
+
 // Type is the component type as it is used in the config.
 type Type string
 
@@ -233,3 +444,269 @@ type Pipeline struct {
 
 // Pipelines is a map of names to Pipelines.
 type Pipelines map[ComponentID]*Pipeline
+
+// InsertPosition indicates where a PipelineMutator should place a ComponentID it
+// injects into a pipeline's processor list.
+type InsertPosition int
+
+const (
+	// InsertAtStart places the processor first in the pipeline, before any
+	// user-configured processors, e.g. for a processor that measures the
+	// pipeline's raw incoming throughput.
+	InsertAtStart InsertPosition = iota
+
+	// InsertBeforeExporters appends the processor after any user-configured
+	// processors, so it is the last processor to see the data before it reaches
+	// the pipeline's exporters, e.g. for a processor that snapshots outgoing data.
+	InsertBeforeExporters
+)
+
+// InsertProcessor inserts id into the pipeline's processor list at pos. It is a
+// convenience for PipelineMutator implementations that inject processors rather
+// than requiring every mutator to reimplement slice surgery.
+func (p *Pipeline) InsertProcessor(id ComponentID, pos InsertPosition) {
+	if pos == InsertAtStart {
+		p.Processors = append([]ComponentID{id}, p.Processors...)
+		return
+	}
+	p.Processors = append(p.Processors, id)
+}
+
+// PipelineMutator mutates a Config's pipelines, and optionally its top-level
+// component maps, before the config is validated. Mutators let deployments
+// transparently inject processors into every pipeline of interest, e.g. a
+// throughput-measurement processor at the head of each pipeline or a snapshot
+// processor immediately before each pipeline's exporters, without forking the
+// collector to add the equivalent processors to every user-authored config.
+type PipelineMutator interface {
+	// Mutate modifies cfg in place. It runs after the config is unmarshaled and
+	// before Config.Validate, so any ComponentID it adds to a pipeline must also
+	// add (or already have) a matching entry in the corresponding top-level map.
+	Mutate(cfg *Config) error
+}
+
+// pipelineMutators is the chain of mutators registered with RegisterPipelineMutator.
+var pipelineMutators []PipelineMutator
+
+// RegisterPipelineMutator adds m to the end of the chain of mutators that
+// ApplyPipelineMutators runs. Mutators run in registration order, so callers
+// that care about the result of an earlier mutator (e.g. to insert before an
+// already-injected processor) must register after it.
+func RegisterPipelineMutator(m PipelineMutator) {
+	pipelineMutators = append(pipelineMutators, m)
+}
+
+// ApplyPipelineMutators runs every mutator registered with RegisterPipelineMutator
+// against cfg, in registration order. The config loader must call this after
+// unmarshaling a Config and before calling Validate, so that any references a
+// mutator injects are present by the time validation runs.
+func ApplyPipelineMutators(cfg *Config) error {
+	for _, m := range pipelineMutators {
+		if err := m.Mutate(cfg); err != nil {
+			return fmt.Errorf("pipeline mutator failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// EndpointConfig is an optional interface implemented by a receiver or exporter
+// configuration that listens on or dials a network endpoint. Config.Graph uses
+// it to detect a receiver and an exporter configured with the same endpoint,
+// which would otherwise form an undetected cycle between two pipelines that
+// look independent on paper.
+type EndpointConfig interface {
+	// Endpoint returns the network address the component listens on or dials.
+	Endpoint() string
+}
+
+// ConfigGraphNodeKind identifies the kind of component a ConfigGraphNode represents.
+type ConfigGraphNodeKind string
+
+const (
+	ReceiverNode  ConfigGraphNodeKind = "receiver"
+	ProcessorNode ConfigGraphNodeKind = "processor"
+	ExporterNode  ConfigGraphNodeKind = "exporter"
+	ExtensionNode ConfigGraphNodeKind = "extension"
+)
+
+// ConfigGraphNode is a single component instance as it is wired at runtime.
+// Receivers, exporters, and extensions are shared across every pipeline that
+// references them and have exactly one node each; a processor is instantiated
+// once per pipeline it appears in, so it has one node per (Pipeline, ID) pair.
+type ConfigGraphNode struct {
+	Kind ConfigGraphNodeKind
+	ID   ComponentID
+
+	// Pipeline is the pipeline this node was instantiated for. It is the zero
+	// ComponentID for receiver, exporter, and extension nodes, which do not
+	// belong to a single pipeline.
+	Pipeline ComponentID
+}
+
+// ConfigGraphEdge is a directed edge from one ConfigGraphNode to another, in the
+// direction data flows between them at runtime.
+type ConfigGraphEdge struct {
+	From ConfigGraphNode
+	To   ConfigGraphNode
+}
+
+// ConfigGraph is a read-only view of the pipeline DAG that a Config describes,
+// including the fan-in of a receiver shared by multiple pipelines and the
+// fan-out of a pipeline's processor chain to multiple exporters.
+type ConfigGraph struct {
+	Nodes []ConfigGraphNode
+	Edges []ConfigGraphEdge
+}
+
+// Graph builds a ConfigGraph describing how cfg's pipelines are wired together
+// at runtime, and returns an error for problems that the flat per-pipeline
+// checks in Validate cannot see: a duplicate ComponentID within one pipeline's
+// processor list, a receiver shared by pipelines of incompatible data types,
+// and a receiver and an exporter configured with the same endpoint. Operator
+// and controller code, as well as test harnesses, can use the returned graph to
+// build a service topology diagram without reimplementing this traversal.
+func (cfg *Config) Graph() (*ConfigGraph, error) {
+	g := &ConfigGraph{}
+
+	receiverNodes := map[ComponentID]ConfigGraphNode{}
+	exporterNodes := map[ComponentID]ConfigGraphNode{}
+	extensionNodes := map[ComponentID]ConfigGraphNode{}
+	receiverDataTypes := map[ComponentID]map[DataType]bool{}
+
+	for _, ref := range cfg.Service.Extensions {
+		if _, ok := extensionNodes[ref]; !ok {
+			node := ConfigGraphNode{Kind: ExtensionNode, ID: ref}
+			extensionNodes[ref] = node
+			g.Nodes = append(g.Nodes, node)
+		}
+	}
+
+	for pipelineID, pipeline := range cfg.Service.Pipelines {
+		inputType, err := pipelineInputType(pipelineID, pipeline)
+		if err != nil {
+			return nil, err
+		}
+
+		seenProcessors := map[ComponentID]bool{}
+		for _, ref := range pipeline.Processors {
+			if seenProcessors[ref] {
+				return nil, fmt.Errorf("pipeline %q references processor %q more than once", pipeline.Name, ref)
+			}
+			seenProcessors[ref] = true
+		}
+
+		for _, ref := range pipeline.Receivers {
+			if receiverDataTypes[ref] == nil {
+				receiverDataTypes[ref] = map[DataType]bool{}
+			}
+			receiverDataTypes[ref][inputType] = true
+			if _, ok := receiverNodes[ref]; !ok {
+				node := ConfigGraphNode{Kind: ReceiverNode, ID: ref}
+				receiverNodes[ref] = node
+				g.Nodes = append(g.Nodes, node)
+			}
+		}
+
+		for _, ref := range pipeline.Exporters {
+			if _, ok := exporterNodes[ref]; !ok {
+				node := ConfigGraphNode{Kind: ExporterNode, ID: ref}
+				exporterNodes[ref] = node
+				g.Nodes = append(g.Nodes, node)
+			}
+		}
+
+		// Build the per-pipeline processor chain and wire receivers -> processors
+		// -> exporters, fanning in from every receiver and fanning out to every
+		// exporter at the ends of the chain that has none of its own.
+		chain := make([]ConfigGraphNode, len(pipeline.Processors))
+		for i, ref := range pipeline.Processors {
+			chain[i] = ConfigGraphNode{Kind: ProcessorNode, ID: ref, Pipeline: pipelineID}
+			g.Nodes = append(g.Nodes, chain[i])
+		}
+
+		for _, recvRef := range pipeline.Receivers {
+			from := receiverNodes[recvRef]
+			if len(chain) > 0 {
+				g.Edges = append(g.Edges, ConfigGraphEdge{From: from, To: chain[0]})
+			} else {
+				for _, expRef := range pipeline.Exporters {
+					g.Edges = append(g.Edges, ConfigGraphEdge{From: from, To: exporterNodes[expRef]})
+				}
+			}
+		}
+		for i := 1; i < len(chain); i++ {
+			g.Edges = append(g.Edges, ConfigGraphEdge{From: chain[i-1], To: chain[i]})
+		}
+		if len(chain) > 0 {
+			last := chain[len(chain)-1]
+			for _, expRef := range pipeline.Exporters {
+				g.Edges = append(g.Edges, ConfigGraphEdge{From: last, To: exporterNodes[expRef]})
+			}
+		}
+	}
+
+	if err := checkReceiverDataTypes(cfg, receiverDataTypes); err != nil {
+		return nil, err
+	}
+
+	if err := checkEndpointCycles(cfg, receiverNodes, exporterNodes); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// checkReceiverDataTypes returns an error if a receiver that implements
+// DataTypeSupporter is referenced by pipelines whose data types aren't all in
+// its SupportedDataTypes(), e.g. a traces-only receiver instance also wired
+// into a metrics pipeline. A shared receiver that does not implement
+// DataTypeSupporter is assumed compatible with every data type it is used
+// with, matching validateDataTypeSupport's per-pipeline check in Validate —
+// this is what lets the common "one otlp receiver feeding a traces pipeline
+// and a metrics pipeline" topology validate cleanly.
+func checkReceiverDataTypes(cfg *Config, requested map[ComponentID]map[DataType]bool) error {
+	for id, types := range requested {
+		supporter, ok := cfg.Receivers[id].(DataTypeSupporter)
+		if !ok {
+			continue
+		}
+		supported := map[DataType]bool{}
+		for _, dt := range supporter.SupportedDataTypes() {
+			supported[dt] = true
+		}
+		var unsupported []string
+		for dt := range types {
+			if !supported[dt] {
+				unsupported = append(unsupported, string(dt))
+			}
+		}
+		if len(unsupported) == 0 {
+			continue
+		}
+		sort.Strings(unsupported)
+		return fmt.Errorf("receiver %q is referenced by pipelines of data types it does not support: %s", id, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// checkEndpointCycles returns an error if any receiver and exporter referenced
+// by the service's pipelines are configured with the same network endpoint.
+// Components that do not implement EndpointConfig are skipped.
+func checkEndpointCycles(cfg *Config, receiverNodes, exporterNodes map[ComponentID]ConfigGraphNode) error {
+	endpoints := map[string]ComponentID{}
+	for id := range receiverNodes {
+		if ec, ok := cfg.Receivers[id].(EndpointConfig); ok && ec.Endpoint() != "" {
+			endpoints[ec.Endpoint()] = id
+		}
+	}
+	for id := range exporterNodes {
+		ec, ok := cfg.Exporters[id].(EndpointConfig)
+		if !ok || ec.Endpoint() == "" {
+			continue
+		}
+		if recvID, ok := endpoints[ec.Endpoint()]; ok {
+			return fmt.Errorf("receiver %q and exporter %q are both configured with endpoint %q, which would create a cycle", recvID, id, ec.Endpoint())
+		}
+	}
+	return nil
+}
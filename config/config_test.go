@@ -0,0 +1,400 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeComponent is a minimal validatable component config, implementing
+// neither DataTypeSupporter nor EndpointConfig, used wherever a test just
+// needs something to put in a Receivers/Exporters/Processors/Extensions map.
+type fakeComponent struct {
+	err error
+}
+
+func (f *fakeComponent) Validate() error { return f.err }
+
+func newFakeComponent() *fakeComponent { return &fakeComponent{} }
+
+func minimalValidConfig() *Config {
+	recv := NewComponentID(Type("nop"))
+	exp := NewComponentID(Type("nop"))
+	pipelineID := NewComponentID(Type("traces"))
+
+	return &Config{
+		Receivers: Receivers{recv: newFakeComponent()},
+		Exporters: Exporters{exp: newFakeComponent()},
+		Service: Service{
+			Telemetry: ServiceTelemetry{Logs: ServiceTelemetryLogs{Encoding: "console"}},
+			Pipelines: Pipelines{
+				pipelineID: {
+					Name:      pipelineID.String(),
+					Receivers: []ComponentID{recv},
+					Exporters: []ComponentID{exp},
+				},
+			},
+		},
+	}
+}
+
+func TestConfigValidateStrictUnused(t *testing.T) {
+	unusedRecv := NewComponentID(Type("unused"))
+
+	t.Run("lenient by default", func(t *testing.T) {
+		cfg := minimalValidConfig()
+		cfg.Receivers[unusedRecv] = newFakeComponent()
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("strict rejects unused receiver", func(t *testing.T) {
+		cfg := minimalValidConfig()
+		cfg.Receivers[unusedRecv] = newFakeComponent()
+		cfg.StrictUnused = true
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `receiver "unused"`)
+	})
+
+	t.Run("strict passes when everything is referenced", func(t *testing.T) {
+		cfg := minimalValidConfig()
+		cfg.StrictUnused = true
+		assert.NoError(t, cfg.Validate())
+	})
+}
+
+type appendProcessorMutator struct {
+	id  ComponentID
+	pos InsertPosition
+}
+
+func (m appendProcessorMutator) Mutate(cfg *Config) error {
+	for _, pipeline := range cfg.Service.Pipelines {
+		pipeline.InsertProcessor(m.id, m.pos)
+	}
+	return nil
+}
+
+func TestPipelineInsertProcessor(t *testing.T) {
+	head := NewComponentID(Type("head"))
+	tail := NewComponentID(Type("tail"))
+	existing := NewComponentID(Type("existing"))
+
+	p := &Pipeline{Processors: []ComponentID{existing}}
+	p.InsertProcessor(head, InsertAtStart)
+	p.InsertProcessor(tail, InsertBeforeExporters)
+
+	assert.Equal(t, []ComponentID{head, existing, tail}, p.Processors)
+}
+
+func TestApplyPipelineMutators(t *testing.T) {
+	defer func() { pipelineMutators = nil }()
+
+	injected := NewComponentID(Type("injected"))
+	RegisterPipelineMutator(appendProcessorMutator{id: injected, pos: InsertBeforeExporters})
+
+	cfg := minimalValidConfig()
+	for _, pipeline := range cfg.Service.Pipelines {
+		require.NotContains(t, pipeline.Processors, injected)
+	}
+
+	require.NoError(t, ApplyPipelineMutators(cfg))
+	cfg.Processors = Processors{injected: newFakeComponent()}
+
+	for _, pipeline := range cfg.Service.Pipelines {
+		assert.Contains(t, pipeline.Processors, injected)
+	}
+	assert.NoError(t, cfg.Validate())
+}
+
+// fakeDataTypeComponent additionally implements DataTypeSupporter, for tests
+// that exercise the data-type compatibility checks.
+type fakeDataTypeComponent struct {
+	fakeComponent
+	supported []DataType
+}
+
+func (f *fakeDataTypeComponent) SupportedDataTypes() []DataType { return f.supported }
+
+func TestPipelineInputType(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        ComponentID
+		inputType DataType
+		want      DataType
+		wantErr   string
+	}{
+		{
+			name: "derived from key",
+			id:   NewComponentID(Type("metrics")),
+			want: MetricsDataType,
+		},
+		{
+			name:      "explicit type agrees with key",
+			id:        NewComponentIDWithName(Type("traces"), "foo"),
+			inputType: TracesDataType,
+			want:      TracesDataType,
+		},
+		{
+			name:      "explicit type disagrees with key",
+			id:        NewComponentID(Type("metrics")),
+			inputType: TracesDataType,
+			wantErr:   "does not match its pipeline type",
+		},
+		{
+			name:    "unknown pipeline type",
+			id:      NewComponentID(Type("foo")),
+			wantErr: "unknown pipeline type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pipelineInputType(tt.id, &Pipeline{Name: tt.id.String(), InputType: tt.inputType})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConfigValidateDataTypeSupport(t *testing.T) {
+	recv := NewComponentID(Type("tracesonly"))
+	exp := NewComponentID(Type("nop"))
+	pipelineID := NewComponentID(Type("metrics"))
+
+	cfg := &Config{
+		Receivers: Receivers{recv: &fakeDataTypeComponent{supported: []DataType{TracesDataType}}},
+		Exporters: Exporters{exp: newFakeComponent()},
+		Service: Service{
+			Telemetry: ServiceTelemetry{Logs: ServiceTelemetryLogs{Encoding: "console"}},
+			Pipelines: Pipelines{
+				pipelineID: {
+					Name:      pipelineID.String(),
+					Receivers: []ComponentID{recv},
+					Exporters: []ComponentID{exp},
+				},
+			},
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `does not support data type "metrics"`)
+}
+
+func TestConfigValidateDataTypeSupportProcessor(t *testing.T) {
+	recv := NewComponentID(Type("nop"))
+	proc := NewComponentID(Type("tracesonly"))
+	exp := NewComponentID(Type("nop"))
+	pipelineID := NewComponentID(Type("metrics"))
+
+	cfg := &Config{
+		Receivers:  Receivers{recv: newFakeComponent()},
+		Processors: Processors{proc: &fakeDataTypeComponent{supported: []DataType{TracesDataType}}},
+		Exporters:  Exporters{exp: newFakeComponent()},
+		Service: Service{
+			Telemetry: ServiceTelemetry{Logs: ServiceTelemetryLogs{Encoding: "console"}},
+			Pipelines: Pipelines{
+				pipelineID: {
+					Name:       pipelineID.String(),
+					Receivers:  []ComponentID{recv},
+					Processors: []ComponentID{proc},
+					Exporters:  []ComponentID{exp},
+				},
+			},
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `does not support data type "metrics"`)
+}
+
+func TestServiceTelemetryMetricsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		srvTM   ServiceTelemetryMetrics
+		wantErr string
+	}{
+		{name: "unset is valid"},
+		{name: "valid level and address", srvTM: ServiceTelemetryMetrics{Level: "detailed", Address: "localhost:8888"}},
+		{name: "invalid level", srvTM: ServiceTelemetryMetrics{Level: "verbose"}, wantErr: "invalid level"},
+		{name: "invalid address", srvTM: ServiceTelemetryMetrics{Level: "basic", Address: "not-a-host-port"}, wantErr: "invalid address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.srvTM.validate()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestServiceTelemetryTracesValidate(t *testing.T) {
+	srvTT := ServiceTelemetryTraces{Propagators: []string{"tracecontext"}}
+	assert.NoError(t, srvTT.validate())
+}
+
+// fakeEndpointComponent additionally implements EndpointConfig, for tests that
+// exercise Config.Graph's endpoint-cycle detection.
+type fakeEndpointComponent struct {
+	fakeComponent
+	endpoint string
+}
+
+func (f *fakeEndpointComponent) Endpoint() string { return f.endpoint }
+
+func TestConfigGraphFanInFanOut(t *testing.T) {
+	otlp := NewComponentID(Type("otlp"))
+	batch := NewComponentID(Type("batch"))
+	otlpExp := NewComponentID(Type("otlpexporter"))
+
+	cfg := &Config{
+		Receivers:  Receivers{otlp: newFakeComponent()},
+		Processors: Processors{batch: newFakeComponent()},
+		Exporters:  Exporters{otlpExp: newFakeComponent()},
+		Service: Service{
+			Pipelines: Pipelines{
+				NewComponentID(Type("traces")): {
+					Name:       "traces",
+					Receivers:  []ComponentID{otlp},
+					Processors: []ComponentID{batch},
+					Exporters:  []ComponentID{otlpExp},
+				},
+				NewComponentID(Type("metrics")): {
+					Name:      "metrics",
+					Receivers: []ComponentID{otlp},
+					Exporters: []ComponentID{otlpExp},
+				},
+			},
+		},
+	}
+
+	graph, err := cfg.Graph()
+	require.NoError(t, err)
+
+	// otlp is a single shared node despite being referenced by two pipelines.
+	receiverCount := 0
+	for _, n := range graph.Nodes {
+		if n.Kind == ReceiverNode {
+			receiverCount++
+		}
+	}
+	assert.Equal(t, 1, receiverCount)
+
+	// The traces pipeline fans receiver -> processor -> exporter (2 edges), and
+	// the metrics pipeline, having no processors, wires its receiver directly
+	// to the exporter (1 edge).
+	assert.Len(t, graph.Edges, 3)
+}
+
+func TestConfigGraphDuplicateProcessor(t *testing.T) {
+	recv := NewComponentID(Type("otlp"))
+	proc := NewComponentID(Type("batch"))
+	exp := NewComponentID(Type("otlpexporter"))
+
+	cfg := &Config{
+		Receivers:  Receivers{recv: newFakeComponent()},
+		Processors: Processors{proc: newFakeComponent()},
+		Exporters:  Exporters{exp: newFakeComponent()},
+		Service: Service{
+			Pipelines: Pipelines{
+				NewComponentID(Type("traces")): {
+					Name:       "traces",
+					Receivers:  []ComponentID{recv},
+					Processors: []ComponentID{proc, proc},
+					Exporters:  []ComponentID{exp},
+				},
+			},
+		},
+	}
+
+	_, err := cfg.Graph()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "more than once")
+}
+
+func TestConfigGraphEndpointCycle(t *testing.T) {
+	recv := NewComponentID(Type("otlp"))
+	exp := NewComponentID(Type("otlpexporter"))
+
+	cfg := &Config{
+		Receivers: Receivers{recv: &fakeEndpointComponent{endpoint: "localhost:4317"}},
+		Exporters: Exporters{exp: &fakeEndpointComponent{endpoint: "localhost:4317"}},
+		Service: Service{
+			Pipelines: Pipelines{
+				NewComponentID(Type("traces")): {
+					Name:      "traces",
+					Receivers: []ComponentID{recv},
+					Exporters: []ComponentID{exp},
+				},
+			},
+		},
+	}
+
+	_, err := cfg.Graph()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would create a cycle")
+}
+
+func TestConfigGraphSharedReceiverAcrossDataTypes(t *testing.T) {
+	otlp := NewComponentID(Type("otlp"))
+	exp := NewComponentID(Type("otlpexporter"))
+
+	newCfg := func(recvCfg validatable) *Config {
+		return &Config{
+			Receivers: Receivers{otlp: recvCfg},
+			Exporters: Exporters{exp: newFakeComponent()},
+			Service: Service{
+				Pipelines: Pipelines{
+					NewComponentID(Type("traces")): {
+						Name:      "traces",
+						Receivers: []ComponentID{otlp},
+						Exporters: []ComponentID{exp},
+					},
+					NewComponentID(Type("metrics")): {
+						Name:      "metrics",
+						Receivers: []ComponentID{otlp},
+						Exporters: []ComponentID{exp},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("no DataTypeSupporter is assumed compatible", func(t *testing.T) {
+		_, err := newCfg(newFakeComponent()).Graph()
+		assert.NoError(t, err)
+	})
+
+	t.Run("DataTypeSupporter missing a used type is rejected", func(t *testing.T) {
+		_, err := newCfg(&fakeDataTypeComponent{supported: []DataType{TracesDataType}}).Graph()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"otlp" is referenced by pipelines of data types it does not support`)
+	})
+}